@@ -0,0 +1,40 @@
+package strategy
+
+import (
+	"fmt"
+
+	buildutil "github.com/openshift/origin/pkg/build/util"
+	"github.com/openshift/origin/pkg/client"
+	"golang.org/x/net/context"
+	kclient "k8s.io/kubernetes/pkg/client/unversioned"
+)
+
+// PipelineStrategy provisions the CI backend a Pipeline strategy BuildConfig
+// needs before its build can run, by looking up the PipelineStrategyProvisioner
+// registered for the BuildConfig's pipeline strategy type (see
+// buildutil.RegisterPipelineStrategyProvisioner).
+type PipelineStrategy struct {
+	KubeClient *kclient.Client
+	OSClient   *client.Client
+}
+
+// EnsureProvisioned looks up the provisioner registered for strategyType and
+// uses it to process and instantiate the backend's resources in ns,
+// returning the backend's in-cluster service endpoint. It does not wait for
+// the backend's service to become ready.
+func (s *PipelineStrategy) EnsureProvisioned(ctx context.Context, strategyType, ns string) (string, error) {
+	provisioner, err := buildutil.NewPipelineStrategyProvisioner(strategyType, ns, s.KubeClient, s.OSClient)
+	if err != nil {
+		return "", err
+	}
+	if err := provisioner.Process(); err != nil {
+		return "", err
+	}
+	if err := provisioner.Instantiate(ctx); err != nil {
+		return "", err
+	}
+	if errs := provisioner.Errors(); len(errs) > 0 {
+		return "", fmt.Errorf("provisioning %q pipeline strategy backend in %q failed: %v", strategyType, ns, errs)
+	}
+	return provisioner.ServiceEndpoint()
+}
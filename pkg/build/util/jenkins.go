@@ -1,13 +1,17 @@
 package util
 
 import (
+	"encoding/json"
 	"fmt"
+	"sort"
 
 	"github.com/golang/glog"
 	"github.com/openshift/origin/pkg/api/latest"
 	"github.com/openshift/origin/pkg/client"
 	serverapi "github.com/openshift/origin/pkg/cmd/server/api"
 	"github.com/openshift/origin/pkg/template"
+	templateapi "github.com/openshift/origin/pkg/template/api"
+	"golang.org/x/net/context"
 	kapi "k8s.io/kubernetes/pkg/api"
 	kerrs "k8s.io/kubernetes/pkg/api/errors"
 	"k8s.io/kubernetes/pkg/api/meta"
@@ -25,6 +29,29 @@ func NewJenkinsPipelineTemplate(ns string, conf serverapi.JenkinsPipelineConfig,
 	}
 }
 
+// NewJenkinsPipelineStrategyProvisioner returns a PipelineProvisionerFactory
+// bound to conf, suitable for registering the "jenkins" pipeline strategy
+// type with RegisterPipelineStrategyProvisioner at server startup, e.g.:
+//
+//	util.RegisterPipelineStrategyProvisioner("jenkins",
+//		util.NewJenkinsPipelineStrategyProvisioner(cfg.PipelineConfig.Jenkins))
+//
+// The returned JenkinsPipelineTemplate.Options are populated from conf, so
+// cluster operators control Upsert/Force/Rollback/ContinueOnError behavior
+// through JenkinsPipelineConfig rather than a call-site default.
+func NewJenkinsPipelineStrategyProvisioner(conf serverapi.JenkinsPipelineConfig) PipelineProvisionerFactory {
+	return func(ns string, kubeClient *kclient.Client, osClient *client.Client) PipelineStrategyProvisioner {
+		t := NewJenkinsPipelineTemplate(ns, conf, kubeClient, osClient)
+		t.Options = InstantiateOptions{
+			Upsert:          conf.Upsert,
+			Force:           conf.ForceRecreate,
+			Rollback:        conf.Rollback,
+			ContinueOnError: conf.ContinueOnError,
+		}
+		return t
+	}
+}
+
 // JenkinsPipelineTemplate stores the configuration of the
 // JenkinsPipelineStrategy template, used to instantiate the Jenkins service in
 // given namespace.
@@ -36,12 +63,16 @@ type JenkinsPipelineTemplate struct {
 	items           []resourceMapping
 	ProcessErrors   []error
 	CreateErrors    []error
+	Results         []itemResult
+	// Options controls how Instantiate creates or upserts the template
+	// items; see InstantiateOptions.
+	Options InstantiateOptions
 }
 
-// Process processes the Jenkins template. If an error occurs
-func (t *JenkinsPipelineTemplate) Process() *JenkinsPipelineTemplate {
+// Process processes the Jenkins template, satisfying PipelineStrategyProvisioner.
+func (t *JenkinsPipelineTemplate) Process() error {
 	if len(t.items) > 0 {
-		return t
+		return nil
 	}
 	jenkinsTemplate, err := t.osClient.Templates(t.Config.Namespace).Get(t.Config.TemplateName)
 	if err != nil {
@@ -50,26 +81,27 @@ func (t *JenkinsPipelineTemplate) Process() *JenkinsPipelineTemplate {
 		} else {
 			t.ProcessErrors = append(t.ProcessErrors, err)
 		}
-		return t
+		return t.ProcessErrors[len(t.ProcessErrors)-1]
 	}
-	t.ProcessErrors = append(t.ProcessErrors, substituteTemplateParameters(jenkinsTemplate)...)
+	t.ProcessErrors = append(t.ProcessErrors, substituteTemplateParameters(jenkinsTemplate, t.Config.Parameters)...)
 	pTemplate, err := t.osClient.TemplateConfigs(t.TargetNamespace).Create(jenkinsTemplate)
 	if err != nil {
-		t.ProcessErrors = append(t.ProcessErrors, fmt.Errorf("processing Jenkins template %s/%s failed: %v", t.Config.Namespace, t.Config.TemplateName, err))
-		return t
+		err = fmt.Errorf("processing Jenkins template %s/%s failed: %v", t.Config.Namespace, t.Config.TemplateName, err)
+		t.ProcessErrors = append(t.ProcessErrors, err)
+		return err
 	}
 	var mappingErrs []error
 	t.items, mappingErrs = mapJenkinsTemplateResources(pTemplate.Objects)
 	if len(mappingErrs) > 0 {
 		t.ProcessErrors = append(t.ProcessErrors, mappingErrs...)
-		return t
+		return mappingErrs[0]
 	}
 	glog.V(4).Infof("Processed Jenkins pipeline jenkinsTemplate %s/%s", pTemplate.Namespace, pTemplate.Namespace)
-	return t
+	return nil
 }
 
-// injectUserVars injects user specified variables into the Template
-func substituteTemplateParameters(t *templateapi.Template) []error {
+// substituteTemplateParameters injects user specified variables into the Template
+func substituteTemplateParameters(t *templateapi.Template, values map[string]string) []error {
 	var errors []error
 	for name, value := range values {
 		if len(name) == 0 {
@@ -87,8 +119,94 @@ func substituteTemplateParameters(t *templateapi.Template) []error {
 	return errors
 }
 
-// Instantiate instantiates the Jenkins template in the target namespace.
-func (t *JenkinsPipelineTemplate) Instantiate() error {
+// InstantiateOptions controls how JenkinsPipelineTemplate.Instantiate creates
+// the template items in the target namespace.
+type InstantiateOptions struct {
+	// Rollback, when true, deletes every successfully created item (in
+	// reverse creation order) if any item fails to create.
+	Rollback bool
+	// ContinueOnError, when true, keeps creating the remaining items after a
+	// failure instead of stopping at the first one.
+	ContinueOnError bool
+	// Upsert, when true, updates items that already exist in the target
+	// namespace instead of failing with AlreadyExists, so the template can be
+	// re-applied against a namespace where Jenkins is already provisioned.
+	Upsert bool
+	// Force, when true, recreates an existing item whose immutable fields
+	// (e.g. a Service's ClusterIP or a PVC's storage class) have drifted from
+	// the template instead of failing the upsert.
+	Force bool
+}
+
+// immutableSpecFields lists the well-known spec fields that cannot be changed
+// on an existing object via update and instead require the object to be
+// recreated.
+var immutableSpecFields = []string{"clusterIP", "storageClassName"}
+
+// itemResult records the outcome of creating a single resourceMapping so
+// callers can see which components were created, failed, or rolled back.
+type itemResult struct {
+	resourceMapping
+	Created    bool
+	RolledBack bool
+	Err        error
+}
+
+// kindCreationOrder lists well-known Kinds in the order they should be
+// created in, so that resources other components depend on (namespaces,
+// service accounts, secrets, role bindings, config) exist before the
+// components that consume them (deployments, services, routes). Kinds not
+// listed here sort after all known kinds, preserving their relative order.
+var kindCreationOrder = []string{
+	"Namespace",
+	"ServiceAccount",
+	"Secret",
+	"RoleBinding",
+	"ConfigMap",
+	"PersistentVolumeClaim",
+	"ImageStream",
+	"Service",
+	"DeploymentConfig",
+	"Deployment",
+	"Pod",
+	"BuildConfig",
+	"Route",
+}
+
+// orderJenkinsTemplateItems returns a copy of items topologically ordered
+// according to kindCreationOrder. The sort is stable so items of the same, or
+// unlisted, Kind keep their original template ordering relative to each
+// other.
+func orderJenkinsTemplateItems(items []resourceMapping) []resourceMapping {
+	priority := make(map[string]int, len(kindCreationOrder))
+	for i, kind := range kindCreationOrder {
+		priority[kind] = i
+	}
+	ordered := make([]resourceMapping, len(items))
+	copy(ordered, items)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		pi, iKnown := priority[ordered[i].Kind]
+		pj, jKnown := priority[ordered[j].Kind]
+		if !iKnown {
+			pi = len(kindCreationOrder)
+		}
+		if !jKnown {
+			pj = len(kindCreationOrder)
+		}
+		return pi < pj
+	})
+	return ordered
+}
+
+// Instantiate instantiates the Jenkins template in the target namespace,
+// creating namespaces, service accounts, secrets and role bindings ahead of
+// the components that depend on them. If t.Options.Rollback is set and any
+// item fails to create, every item created so far is deleted again in
+// reverse order. If t.Options.Upsert is set, items that already exist are
+// updated in place instead of failing with AlreadyExists, which makes
+// Instantiate safe to re-run against a namespace that has already been
+// provisioned. Instantiate satisfies PipelineStrategyProvisioner.
+func (t *JenkinsPipelineTemplate) Instantiate(ctx context.Context) error {
 	if len(t.Errors()) > 0 {
 		return fmt.Errorf("unable to instantiate Jenkins, processing jenkins template failed")
 	}
@@ -97,26 +215,205 @@ func (t *JenkinsPipelineTemplate) Instantiate() error {
 		t.CreateErrors = append(t.CreateErrors, err)
 		return err
 	}
-	counter := 0
-	for _, item := range t.items {
-		var err error
-		if item.IsOrigin {
-			err = t.osClient.Post().Namespace(t.TargetNamespace).Resource(item.Resource).Body(item.RawJSON).Do().Error()
-		} else {
-			err = t.kubeClient.Post().Namespace(t.TargetNamespace).Resource(item.Resource).Body(item.RawJSON).Do().Error()
+	opts := t.Options
+	var created []resourceMapping
+	var failures int
+	for _, item := range orderJenkinsTemplateItems(t.items) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
 		}
+		isNew, err := t.applyItem(item, opts)
+		t.Results = append(t.Results, itemResult{resourceMapping: item, Created: isNew && err == nil, Err: err})
 		if err != nil {
+			failures++
 			t.CreateErrors = append(t.CreateErrors, fmt.Errorf("creating Jenkins component %s/%s failed: %v", item.Kind, item.Name, err))
+			if !opts.ContinueOnError {
+				break
+			}
 			continue
 		}
-		counter++
+		if isNew {
+			created = append(created, item)
+		}
 	}
-	delta := len(t.items) - counter
-	if delta != 0 {
-		// TODO: Shold we rollback in this case?
-		return fmt.Errorf("%d Jenkins pipeline components failed to create", delta)
+	if failures == 0 {
+		return nil
+	}
+	if opts.Rollback {
+		t.rollback(created)
+	}
+	return fmt.Errorf("%d Jenkins pipeline components failed to create", failures)
+}
+
+// ServiceEndpoint returns the in-cluster address of the Jenkins service
+// created from the template, satisfying PipelineStrategyProvisioner.
+func (t *JenkinsPipelineTemplate) ServiceEndpoint() (string, error) {
+	if len(t.Errors()) > 0 {
+		return "", fmt.Errorf("unable to determine Jenkins service endpoint, processing Jenkins template failed")
+	}
+	for _, item := range t.items {
+		if item.Kind != "Service" || item.Name != t.Config.ServiceName {
+			continue
+		}
+		var svc struct {
+			Spec struct {
+				Ports []struct {
+					Port int32 `json:"port"`
+				} `json:"ports"`
+			} `json:"spec"`
+		}
+		if err := json.Unmarshal(item.RawJSON, &svc); err != nil {
+			return "", fmt.Errorf("unable to parse Jenkins service %q: %v", item.Name, err)
+		}
+		if len(svc.Spec.Ports) == 0 {
+			return "", fmt.Errorf("Jenkins service %q does not expose any ports", item.Name)
+		}
+		return fmt.Sprintf("%s.%s.svc:%d", item.Name, t.TargetNamespace, svc.Spec.Ports[0].Port), nil
+	}
+	return "", fmt.Errorf("template %s/%s does not contain required service %q", t.Config.Namespace, t.Config.TemplateName, t.Config.ServiceName)
+}
+
+// applyItem creates item, or, when opts.Upsert is set, updates it in place if
+// it already exists. An update that would require changing an immutable spec
+// field only proceeds when opts.Force is set, in which case the existing
+// object is deleted and recreated. The returned bool is true when item was
+// (re)created rather than updated in place.
+func (t *JenkinsPipelineTemplate) applyItem(item resourceMapping, opts InstantiateOptions) (bool, error) {
+	if !opts.Upsert {
+		return true, t.createItem(item)
+	}
+	existing, err := t.getItem(item)
+	if err != nil {
+		if kerrs.IsNotFound(err) {
+			return true, t.createItem(item)
+		}
+		return false, err
+	}
+	merged, recreate, err := mergeForUpdate(existing, item.RawJSON)
+	if err != nil {
+		return false, fmt.Errorf("unable to merge %s %q for update: %v", item.Kind, item.Name, err)
+	}
+	if recreate {
+		if !opts.Force {
+			return false, fmt.Errorf("%s %q has drifted immutable fields, rerun with Force to recreate it", item.Kind, item.Name)
+		}
+		if err := t.deleteItem(item); err != nil {
+			return false, err
+		}
+		return true, t.createItem(item)
+	}
+	return false, t.updateItem(item, merged)
+}
+
+// mergeForUpdate builds the request body for updating an existing object with
+// the template's desired state: it carries over the existing resourceVersion
+// so the update is accepted, and preserves immutableSpecFields from the
+// existing object unless the desired value differs, in which case recreate is
+// returned true so the caller can recreate the object instead.
+func mergeForUpdate(existing, desired []byte) ([]byte, bool, error) {
+	var existingObj, desiredObj map[string]interface{}
+	if err := json.Unmarshal(existing, &existingObj); err != nil {
+		return nil, false, err
+	}
+	if err := json.Unmarshal(desired, &desiredObj); err != nil {
+		return nil, false, err
+	}
+
+	if existingMeta, ok := existingObj["metadata"].(map[string]interface{}); ok {
+		desiredMeta, ok := desiredObj["metadata"].(map[string]interface{})
+		if !ok {
+			desiredMeta = map[string]interface{}{}
+			desiredObj["metadata"] = desiredMeta
+		}
+		desiredMeta["resourceVersion"] = existingMeta["resourceVersion"]
+	}
+
+	recreate := false
+	existingSpec, existingHasSpec := existingObj["spec"].(map[string]interface{})
+	desiredSpec, desiredHasSpec := desiredObj["spec"].(map[string]interface{})
+	if existingHasSpec && desiredHasSpec {
+		for _, field := range immutableSpecFields {
+			existingVal, ok := existingSpec[field]
+			if !ok || existingVal == "" {
+				continue
+			}
+			if desiredVal, ok := desiredSpec[field]; ok && desiredVal != "" && desiredVal != existingVal {
+				recreate = true
+				break
+			}
+			desiredSpec[field] = existingVal
+		}
+	}
+	if recreate {
+		return nil, true, nil
+	}
+
+	merged, err := json.Marshal(desiredObj)
+	return merged, false, err
+}
+
+// createItem posts a single resourceMapping to the appropriate origin or kube
+// client, depending on which API group it belongs to.
+func (t *JenkinsPipelineTemplate) createItem(item resourceMapping) error {
+	if item.IsOrigin {
+		return t.osClient.Post().Namespace(t.TargetNamespace).Resource(item.Resource).Body(item.RawJSON).Do().Error()
+	}
+	return t.kubeClient.Post().Namespace(t.TargetNamespace).Resource(item.Resource).Body(item.RawJSON).Do().Error()
+}
+
+// getItem fetches the raw JSON of an existing item, returning a NotFound
+// error (recognisable via kerrs.IsNotFound) when it does not exist.
+func (t *JenkinsPipelineTemplate) getItem(item resourceMapping) ([]byte, error) {
+	if item.IsOrigin {
+		return t.osClient.Get().Namespace(t.TargetNamespace).Resource(item.Resource).Name(item.Name).Do().Raw()
+	}
+	return t.kubeClient.Get().Namespace(t.TargetNamespace).Resource(item.Resource).Name(item.Name).Do().Raw()
+}
+
+// updateItem replaces an existing item with the given body.
+func (t *JenkinsPipelineTemplate) updateItem(item resourceMapping, body []byte) error {
+	if item.IsOrigin {
+		return t.osClient.Put().Namespace(t.TargetNamespace).Resource(item.Resource).Name(item.Name).Body(body).Do().Error()
+	}
+	return t.kubeClient.Put().Namespace(t.TargetNamespace).Resource(item.Resource).Name(item.Name).Body(body).Do().Error()
+}
+
+// deleteItem deletes an existing item.
+func (t *JenkinsPipelineTemplate) deleteItem(item resourceMapping) error {
+	if item.IsOrigin {
+		return t.osClient.Delete().Namespace(t.TargetNamespace).Resource(item.Resource).Name(item.Name).Do().Error()
+	}
+	return t.kubeClient.Delete().Namespace(t.TargetNamespace).Resource(item.Resource).Name(item.Name).Do().Error()
+}
+
+// rollback deletes the given items in reverse order, logging but otherwise
+// ignoring failures so that a single stuck delete does not stop the rest of
+// the rollback from proceeding. Each successfully deleted item has its
+// corresponding t.Results entry marked RolledBack so callers can tell it was
+// created and then removed again, rather than left in place.
+func (t *JenkinsPipelineTemplate) rollback(created []resourceMapping) {
+	for i := len(created) - 1; i >= 0; i-- {
+		item := created[i]
+		if err := t.deleteItem(item); err != nil {
+			glog.Errorf("rollback: failed to delete Jenkins component %s %q: %v", item.Kind, item.Name, err)
+			continue
+		}
+		t.markRolledBack(item)
+		glog.V(4).Infof("rollback: deleted Jenkins component %s %q", item.Kind, item.Name)
+	}
+}
+
+// markRolledBack flags the t.Results entry for item as rolled back.
+func (t *JenkinsPipelineTemplate) markRolledBack(item resourceMapping) {
+	for i := range t.Results {
+		r := &t.Results[i]
+		if r.Kind == item.Kind && r.Name == item.Name && r.Resource == item.Resource {
+			r.RolledBack = true
+			return
+		}
 	}
-	return nil
 }
 
 // Errors returns the list of processing and creation errors.
@@ -149,12 +446,15 @@ func (t *JenkinsPipelineTemplate) hasJenkinsService() bool {
 }
 
 // jenkinsTemplateResourcesToMap converts the input runtime.Object provided by
-// processed Jenkins template into a resource mappings ready for creation.
+// processed Jenkins template into a resource mappings ready for creation. List
+// objects (e.g. a `kind: List` wrapping a set of ConfigMaps or RoleBindings)
+// are flattened recursively so every leaf item gets its own mapping, in the
+// order they appear in the template.
 func mapJenkinsTemplateResources(input []runtime.Object) ([]resourceMapping, []error) {
-	result := make([]resourceMapping, len(input))
+	var result []resourceMapping
 	var resultErrs []error
 	accessor := meta.NewAccessor()
-	for index, item := range input {
+	for _, item := range input {
 		rawObj, ok := item.(*runtime.Unknown)
 		if !ok {
 			resultErrs = append(resultErrs, fmt.Errorf("unable to convert %+v to unknown object", item))
@@ -165,24 +465,63 @@ func mapJenkinsTemplateResources(input []runtime.Object) ([]resourceMapping, []e
 			resultErrs = append(resultErrs, fmt.Errorf("unable to decode %q", rawObj.RawJSON))
 			continue
 		}
-		kind, err := kapi.Scheme.ObjectKind(obj)
+		mappings, errs := flattenJenkinsTemplateResource(obj, rawObj.RawJSON, accessor)
+		result = append(result, mappings...)
+		resultErrs = append(resultErrs, errs...)
+	}
+	return result, resultErrs
+}
+
+// flattenJenkinsTemplateResource maps a single decoded template object into a
+// resourceMapping. If obj is a List (or wraps further Lists), it is expanded
+// recursively and each contained item is mapped individually, preserving the
+// original ordering so that dependent objects are still created in order.
+// rawJSON is only used for non-List objects; list items are re-encoded after
+// ExtractList/DecodeList since they no longer carry their original bytes.
+func flattenJenkinsTemplateResource(obj runtime.Object, rawJSON []byte, accessor meta.MetadataAccessor) ([]resourceMapping, []error) {
+	if runtime.IsListType(obj) {
+		items, err := meta.ExtractList(obj)
 		if err != nil {
-			resultErrs = append(resultErrs, fmt.Errorf("unknown kind %+v ", obj))
-			continue
+			return nil, []error{fmt.Errorf("unable to extract List items from %+v: %v", obj, err)}
 		}
-		plural, _ := meta.KindToResource(kind)
-		name, err := accessor.Name(obj)
-		if err != nil {
-			resultErrs = append(resultErrs, fmt.Errorf("unknown name %+v ", obj))
-			continue
+		// DecodeList decodes each item in place and returns the per-item
+		// errors; items that failed to decode are left untouched (still
+		// *runtime.Unknown) so we skip just those and keep flattening the
+		// rest, instead of aborting the whole embedded List.
+		resultErrs := runtime.DecodeList(items, kapi.Codecs.UniversalDecoder())
+		var result []resourceMapping
+		for _, item := range items {
+			if _, stillUndecoded := item.(*runtime.Unknown); stillUndecoded {
+				continue
+			}
+			mappings, errs := flattenJenkinsTemplateResource(item, nil, accessor)
+			result = append(result, mappings...)
+			resultErrs = append(resultErrs, errs...)
 		}
-		result[index] = resourceMapping{
-			Name:     name,
-			Kind:     kind.Kind,
-			Resource: plural.Resource,
-			RawJSON:  rawObj.RawJSON,
-			IsOrigin: latest.IsKindInAnyOriginGroup(kind.Kind),
+		return result, resultErrs
+	}
+
+	kind, err := kapi.Scheme.ObjectKind(obj)
+	if err != nil {
+		return nil, []error{fmt.Errorf("unknown kind %+v ", obj)}
+	}
+	plural, _ := meta.KindToResource(kind)
+	name, err := accessor.Name(obj)
+	if err != nil {
+		return nil, []error{fmt.Errorf("unknown name %+v ", obj)}
+	}
+	if len(rawJSON) == 0 {
+		encoded, err := runtime.Encode(kapi.Codecs.LegacyCodec(kind.GroupVersion()), obj)
+		if err != nil {
+			return nil, []error{fmt.Errorf("unable to encode %s %q: %v", kind.Kind, name, err)}
 		}
+		rawJSON = encoded
 	}
-	return result, resultErrs
+	return []resourceMapping{{
+		Name:     name,
+		Kind:     kind.Kind,
+		Resource: plural.Resource,
+		RawJSON:  rawJSON,
+		IsOrigin: latest.IsKindInAnyOriginGroup(kind.Kind),
+	}}, nil
 }
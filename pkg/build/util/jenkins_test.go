@@ -0,0 +1,149 @@
+package util
+
+import (
+	"encoding/json"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/runtime"
+)
+
+func TestMapJenkinsTemplateResourcesAggregatesListErrors(t *testing.T) {
+	serviceJSON := `{"kind":"Service","apiVersion":"v1","metadata":{"name":"jenkins"},"spec":{"ports":[{"port":80}]}}`
+	validConfigMapJSON := `{"kind":"ConfigMap","apiVersion":"v1","metadata":{"name":"jenkins-plugins"}}`
+	malformedJSON := `{"kind":"Bogus","apiVersion":"does-not-exist/v1","metadata":{"name":"broken"}}`
+	listJSON := `{"kind":"List","apiVersion":"v1","items":[` + validConfigMapJSON + `,` + malformedJSON + `]}`
+
+	input := []runtime.Object{
+		&runtime.Unknown{RawJSON: []byte(serviceJSON)},
+		&runtime.Unknown{RawJSON: []byte(listJSON)},
+	}
+
+	result, errs := mapJenkinsTemplateResources(input)
+
+	if len(errs) != 1 {
+		t.Fatalf("expected exactly 1 error for the malformed List item, got %d: %v", len(errs), errs)
+	}
+
+	var names []string
+	for _, m := range result {
+		names = append(names, m.Name)
+	}
+	if len(result) != 2 {
+		t.Fatalf("expected the Service and the one valid ConfigMap to survive the malformed sibling, got %d items: %v", len(result), names)
+	}
+	if result[0].Name != "jenkins" || result[0].Kind != "Service" {
+		t.Errorf("expected first item to be the jenkins Service, got %+v", result[0])
+	}
+	if result[1].Name != "jenkins-plugins" || result[1].Kind != "ConfigMap" {
+		t.Errorf("expected second item to be the jenkins-plugins ConfigMap from the List, got %+v", result[1])
+	}
+}
+
+func TestOrderJenkinsTemplateItems(t *testing.T) {
+	items := []resourceMapping{
+		{Name: "jenkins", Kind: "Route"},
+		{Name: "jenkins", Kind: "Service"},
+		{Name: "jenkins-edit", Kind: "RoleBinding"},
+		{Name: "custom-resource", Kind: "Bogus"},
+		{Name: "jenkins", Kind: "ServiceAccount"},
+		{Name: "another-custom-resource", Kind: "Bogus"},
+		{Name: "jenkins", Kind: "Namespace"},
+	}
+
+	ordered := orderJenkinsTemplateItems(items)
+
+	if len(ordered) != len(items) {
+		t.Fatalf("expected %d items, got %d", len(items), len(ordered))
+	}
+
+	indexOf := func(kind string) int {
+		for i, item := range ordered {
+			if item.Kind == kind {
+				return i
+			}
+		}
+		t.Fatalf("expected an item of kind %q in the ordered output", kind)
+		return -1
+	}
+
+	if indexOf("Namespace") > indexOf("ServiceAccount") {
+		t.Errorf("Namespace should be ordered before ServiceAccount")
+	}
+	if indexOf("ServiceAccount") > indexOf("RoleBinding") {
+		t.Errorf("ServiceAccount should be ordered before RoleBinding")
+	}
+	if indexOf("RoleBinding") > indexOf("Service") {
+		t.Errorf("RoleBinding should be ordered before Service")
+	}
+	if indexOf("Service") > indexOf("Route") {
+		t.Errorf("Service should be ordered before Route")
+	}
+
+	// Kinds with no known priority (e.g. custom resources) are unknown to
+	// kindCreationOrder and so sort after everything else, preserving their
+	// original relative order.
+	if ordered[len(ordered)-2].Name != "custom-resource" || ordered[len(ordered)-1].Name != "another-custom-resource" {
+		t.Errorf("expected unlisted kinds to keep their original relative order at the end, got %+v", ordered)
+	}
+
+	// The input slice itself must not be mutated.
+	if items[0].Kind != "Route" {
+		t.Errorf("orderJenkinsTemplateItems must not mutate its input, got %+v", items)
+	}
+}
+
+func TestMergeForUpdate(t *testing.T) {
+	existing := `{"kind":"Service","metadata":{"name":"jenkins","resourceVersion":"42"},"spec":{"clusterIP":"172.30.1.1"}}`
+
+	t.Run("carries over resourceVersion", func(t *testing.T) {
+		desired := `{"kind":"Service","metadata":{"name":"jenkins"},"spec":{"clusterIP":"172.30.1.1"}}`
+		merged, recreate, err := mergeForUpdate([]byte(existing), []byte(desired))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if recreate {
+			t.Fatalf("did not expect a recreate when the immutable field matches")
+		}
+		var obj map[string]interface{}
+		if err := json.Unmarshal(merged, &obj); err != nil {
+			t.Fatalf("merged body is not valid JSON: %v", err)
+		}
+		meta := obj["metadata"].(map[string]interface{})
+		if meta["resourceVersion"] != "42" {
+			t.Errorf("expected resourceVersion 42 to be carried over, got %v", meta["resourceVersion"])
+		}
+	})
+
+	t.Run("fills in an unset immutable field from the existing object", func(t *testing.T) {
+		desired := `{"kind":"Service","metadata":{"name":"jenkins"},"spec":{}}`
+		merged, recreate, err := mergeForUpdate([]byte(existing), []byte(desired))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if recreate {
+			t.Fatalf("did not expect a recreate when the desired object omits the immutable field")
+		}
+		var obj map[string]interface{}
+		if err := json.Unmarshal(merged, &obj); err != nil {
+			t.Fatalf("merged body is not valid JSON: %v", err)
+		}
+		spec := obj["spec"].(map[string]interface{})
+		if spec["clusterIP"] != "172.30.1.1" {
+			t.Errorf("expected clusterIP to be preserved from the existing object, got %v", spec["clusterIP"])
+		}
+	})
+
+	t.Run("requests a recreate when an immutable field has drifted", func(t *testing.T) {
+		desired := `{"kind":"Service","metadata":{"name":"jenkins"},"spec":{"clusterIP":"172.30.9.9"}}`
+		merged, recreate, err := mergeForUpdate([]byte(existing), []byte(desired))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !recreate {
+			t.Fatalf("expected a recreate when clusterIP differs from the existing object")
+		}
+		if merged != nil {
+			t.Errorf("expected no merged body when a recreate is requested, got %q", merged)
+		}
+	})
+}
@@ -0,0 +1,61 @@
+package util
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/openshift/origin/pkg/client"
+	kclient "k8s.io/kubernetes/pkg/client/unversioned"
+
+	"golang.org/x/net/context"
+)
+
+// PipelineStrategyProvisioner provisions and manages the backend service a
+// pipeline BuildStrategy runs against (Jenkins, Tekton, ...), so that
+// pkg/build/controller/strategy does not need to know which CI backend a
+// BuildConfig's pipeline strategy targets.
+type PipelineStrategyProvisioner interface {
+	// Process prepares the backend's resources (e.g. processing a template)
+	// without creating anything yet.
+	Process() error
+	// Instantiate creates or updates the backend's resources in the target
+	// namespace.
+	Instantiate(ctx context.Context) error
+	// Errors returns the processing and creation errors accumulated so far.
+	Errors() []error
+	// ServiceEndpoint returns the in-cluster address of the backend's
+	// service once Instantiate has succeeded.
+	ServiceEndpoint() (string, error)
+}
+
+// PipelineProvisionerFactory creates a PipelineStrategyProvisioner for a
+// single pipeline strategy type, bound to the given namespace and clients.
+type PipelineProvisionerFactory func(ns string, kubeClient *kclient.Client, osClient *client.Client) PipelineStrategyProvisioner
+
+var (
+	provisionersMu sync.RWMutex
+	provisioners   = map[string]PipelineProvisionerFactory{}
+)
+
+// RegisterPipelineStrategyProvisioner registers factory under strategyType,
+// the value of serverapi.PipelineStrategyConfig.Type a BuildConfig's pipeline
+// strategy is matched against. Server startup code populates this registry
+// from MasterConfig before the build controllers start, so third parties can
+// plug in their own CI backend without patching this package.
+func RegisterPipelineStrategyProvisioner(strategyType string, factory PipelineProvisionerFactory) {
+	provisionersMu.Lock()
+	defer provisionersMu.Unlock()
+	provisioners[strategyType] = factory
+}
+
+// NewPipelineStrategyProvisioner looks up the factory registered for
+// strategyType and uses it to build a PipelineStrategyProvisioner for ns.
+func NewPipelineStrategyProvisioner(strategyType, ns string, kubeClient *kclient.Client, osClient *client.Client) (PipelineStrategyProvisioner, error) {
+	provisionersMu.RLock()
+	factory, ok := provisioners[strategyType]
+	provisionersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no pipeline strategy provisioner registered for type %q", strategyType)
+	}
+	return factory(ns, kubeClient, osClient), nil
+}
@@ -0,0 +1,19 @@
+package api
+
+// PipelineStrategyConfig selects and configures the pipeline strategy
+// backend (Jenkins, Tekton, ...) used to run Pipeline strategy builds.
+type PipelineStrategyConfig struct {
+	// Type identifies the PipelineStrategyProvisioner that should handle
+	// BuildConfigs using this pipeline strategy, e.g. "jenkins".
+	Type string
+	// Jenkins holds the configuration used when Type is "jenkins".
+	Jenkins JenkinsPipelineConfig
+}
+
+// MasterConfig is the subset of the master configuration needed to
+// provision pipeline strategy backends.
+type MasterConfig struct {
+	// PipelineConfig configures the pipeline strategy backend available to
+	// BuildConfigs in this cluster.
+	PipelineConfig PipelineStrategyConfig
+}
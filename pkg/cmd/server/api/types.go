@@ -0,0 +1,36 @@
+package api
+
+// JenkinsPipelineConfig holds configuration for the Jenkins instance that is
+// auto-provisioned to run Pipeline strategy builds.
+type JenkinsPipelineConfig struct {
+	// AutoProvisionEnabled, if true, causes the Pipeline strategy to
+	// auto-provision a Jenkins instance in the project if one does not
+	// already exist.
+	AutoProvisionEnabled *bool
+	// Namespace is the namespace containing the Jenkins pipeline template.
+	Namespace string
+	// TemplateName is the name of the template to instantiate for the
+	// Jenkins instance.
+	TemplateName string
+	// ServiceName is the name of the service, within the template, that
+	// exposes the Jenkins server.
+	ServiceName string
+	// Parameters specifies user-supplied overrides for the Jenkins pipeline
+	// template's parameters, keyed by parameter name.
+	Parameters map[string]string
+
+	// Upsert, when true, updates the Jenkins template's resources in place
+	// if they already exist, instead of failing with AlreadyExists, so the
+	// template can be safely re-applied against an already-provisioned
+	// namespace (e.g. on upgrade).
+	Upsert bool
+	// ForceRecreate, when true, lets Upsert recreate a resource whose
+	// immutable fields have drifted from the template instead of failing.
+	ForceRecreate bool
+	// Rollback, when true, deletes every resource created so far if
+	// instantiating the template fails partway through.
+	Rollback bool
+	// ContinueOnError, when true, keeps creating the template's remaining
+	// resources after one fails instead of stopping at the first failure.
+	ContinueOnError bool
+}
@@ -0,0 +1,20 @@
+package origin
+
+import (
+	buildutil "github.com/openshift/origin/pkg/build/util"
+	"github.com/openshift/origin/pkg/client"
+	serverapi "github.com/openshift/origin/pkg/cmd/server/api"
+	kclient "k8s.io/kubernetes/pkg/client/unversioned"
+)
+
+// RegisterPipelineStrategyProvisioners populates the pipeline strategy
+// provisioner registry from the master configuration. It must run during
+// server startup, before the build controllers start, so that
+// pkg/build/controller/strategy can look up a provisioner by pipeline strategy
+// type. It registers only the "jenkins" type, built from
+// cfg.PipelineConfig.Jenkins; cfg.PipelineConfig.Type is not read, and other
+// types are available only once registered with
+// buildutil.RegisterPipelineStrategyProvisioner.
+func RegisterPipelineStrategyProvisioners(cfg serverapi.MasterConfig, kubeClient *kclient.Client, osClient *client.Client) {
+	buildutil.RegisterPipelineStrategyProvisioner("jenkins", buildutil.NewJenkinsPipelineStrategyProvisioner(cfg.PipelineConfig.Jenkins))
+}